@@ -0,0 +1,42 @@
+/*
+Copyright 2019 The Skaffold Authors
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package local
+
+import (
+	"os"
+	"path/filepath"
+	"time"
+
+	"github.com/GoogleContainerTools/skaffold/pkg/skaffold/schema/latest"
+	"github.com/pkg/errors"
+)
+
+// bazelStampTimestamp returns the mtime of the `bazel-out` stable status
+// file produced by a stamped build. Bazel rewrites volatile-status.txt on
+// every single build regardless of whether any input changed, which is the
+// opposite of what reproducible builds need; stable-status.txt (which backs
+// stamp variables like BUILD_TIMESTAMP) only changes when its own inputs do.
+func bazelStampTimestamp(workspace string, _ *latest.BazelArtifact) (time.Time, error) {
+	stampFile := filepath.Join(workspace, "bazel-out", "stable-status.txt")
+
+	info, err := os.Stat(stampFile)
+	if err != nil {
+		return time.Time{}, errors.Wrapf(err, "reading bazel stamp file %q", stampFile)
+	}
+
+	return info.ModTime().UTC(), nil
+}
@@ -0,0 +1,71 @@
+/*
+Copyright 2019 The Skaffold Authors
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package local
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/GoogleContainerTools/skaffold/pkg/skaffold/schema/latest"
+)
+
+func TestBazelStampTimestampUsesStableStatusFile(t *testing.T) {
+	dir := t.TempDir()
+	bazelOut := filepath.Join(dir, "bazel-out")
+	if err := os.MkdirAll(bazelOut, 0755); err != nil {
+		t.Fatalf("creating bazel-out dir: %v", err)
+	}
+
+	stable := filepath.Join(bazelOut, "stable-status.txt")
+	if err := ioutil.WriteFile(stable, []byte("BUILD_TIMESTAMP 1\n"), 0644); err != nil {
+		t.Fatalf("writing stable-status.txt: %v", err)
+	}
+	want := time.Date(2019, 6, 15, 12, 0, 0, 0, time.UTC)
+	if err := os.Chtimes(stable, want, want); err != nil {
+		t.Fatalf("setting mtime: %v", err)
+	}
+
+	// volatile-status.txt is rewritten on every build regardless of
+	// whether any input changed; give it a much newer mtime to make sure
+	// bazelStampTimestamp ignores it in favor of the stable file.
+	volatile := filepath.Join(bazelOut, "volatile-status.txt")
+	if err := ioutil.WriteFile(volatile, []byte("BUILD_TIMESTAMP 2\n"), 0644); err != nil {
+		t.Fatalf("writing volatile-status.txt: %v", err)
+	}
+	if err := os.Chtimes(volatile, time.Now(), time.Now()); err != nil {
+		t.Fatalf("setting mtime: %v", err)
+	}
+
+	got, err := bazelStampTimestamp(dir, &latest.BazelArtifact{})
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if !got.Equal(want) {
+		t.Fatalf("got %v, want the stable-status.txt mtime %v", got, want)
+	}
+}
+
+func TestBazelStampTimestampMissingFile(t *testing.T) {
+	dir := t.TempDir()
+
+	if _, err := bazelStampTimestamp(dir, &latest.BazelArtifact{}); err == nil {
+		t.Fatal("expected an error when stable-status.txt doesn't exist")
+	}
+}
@@ -0,0 +1,220 @@
+/*
+Copyright 2019 The Skaffold Authors
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package local
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sort"
+	"sync"
+
+	"github.com/GoogleContainerTools/skaffold/pkg/skaffold/color"
+	"github.com/GoogleContainerTools/skaffold/pkg/skaffold/schema/latest"
+	"github.com/pkg/errors"
+	"github.com/sirupsen/logrus"
+)
+
+const cacheFileName = "cache.json"
+
+// cacheEntry remembers, for one image name, the dependency hash that last
+// produced it and the resulting imageID.
+type cacheEntry struct {
+	Hash    string `json:"hash"`
+	ImageID string `json:"imageID"`
+}
+
+// buildCache is a small, flat, JSON-backed cache of build results keyed on
+// artifact image name. It lives in ~/.skaffold/cache and is shared by every
+// project on the machine, the same way the daemon's own image cache is.
+type buildCache struct {
+	path string
+
+	mu      sync.Mutex
+	entries map[string]cacheEntry
+}
+
+func newBuildCache() (*buildCache, error) {
+	dir, err := cacheDir()
+	if err != nil {
+		return nil, errors.Wrap(err, "getting cache directory")
+	}
+	return newBuildCacheAt(dir)
+}
+
+// newBuildCacheAt loads (or initializes) a buildCache rooted at dir. It's
+// split out from newBuildCache so tests can point it at a temp directory
+// instead of the real ~/.skaffold/cache.
+func newBuildCacheAt(dir string) (*buildCache, error) {
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return nil, errors.Wrap(err, "creating cache directory")
+	}
+
+	c := &buildCache{
+		path:    filepath.Join(dir, cacheFileName),
+		entries: map[string]cacheEntry{},
+	}
+
+	contents, err := ioutil.ReadFile(c.path)
+	if os.IsNotExist(err) {
+		return c, nil
+	}
+	if err != nil {
+		return nil, errors.Wrap(err, "reading cache file")
+	}
+	if err := json.Unmarshal(contents, &c.entries); err != nil {
+		logrus.Warnf("ignoring corrupt build cache %s: %v", c.path, err)
+		c.entries = map[string]cacheEntry{}
+	}
+
+	return c, nil
+}
+
+func cacheDir() (string, error) {
+	home, err := os.UserHomeDir()
+	if err != nil {
+		return "", err
+	}
+	return filepath.Join(home, ".skaffold", "cache"), nil
+}
+
+func (c *buildCache) lookup(imageName, hash string) (string, bool) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	entry, found := c.entries[imageName]
+	if !found || entry.Hash != hash {
+		return "", false
+	}
+	return entry.ImageID, true
+}
+
+func (c *buildCache) store(imageName, hash, imageID string) error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	c.entries[imageName] = cacheEntry{Hash: hash, ImageID: imageID}
+	contents, err := json.MarshalIndent(c.entries, "", "  ")
+	if err != nil {
+		return err
+	}
+
+	// The write happens while still holding the lock: two goroutines
+	// racing to persist different entries must not interleave their
+	// writes of the whole file, or one's entry silently clobbers the
+	// other's on disk.
+	return ioutil.WriteFile(c.path, contents, 0644)
+}
+
+// buildArtifactWithCache wraps buildAndRewrite with a content-addressable
+// cache: if nothing the artifact depends on has changed since the last
+// build, and the resulting image is still present, the build is skipped
+// entirely and the cached imageID/digest is reused. The cache stores the
+// fully processed result, so that a cache hit and a cache miss are
+// interchangeable from the caller's point of view.
+func (b *Builder) buildArtifactWithCache(ctx context.Context, out io.Writer, artifact *latest.Artifact, tag string) (string, error) {
+	hash, err := b.hashArtifact(ctx, artifact)
+	if err != nil {
+		logrus.Debugln("computing cache key failed, building without cache:", err)
+		return b.buildAndRewrite(ctx, out, artifact, tag)
+	}
+
+	if cached, found := b.cache.lookup(artifact.ImageName, hash); found {
+		if b.imageStillValid(ctx, cached) {
+			color.Default.Fprintf(out, "Found cached artifact for [%s], skipping build.\n", artifact.ImageName)
+			return cached, nil
+		}
+	}
+
+	digestOrImageID, err := b.buildAndRewrite(ctx, out, artifact, tag)
+	if err != nil {
+		return "", err
+	}
+
+	if err := b.cache.store(artifact.ImageName, hash, digestOrImageID); err != nil {
+		logrus.Debugln("failed to persist build cache entry:", err)
+	}
+
+	return digestOrImageID, nil
+}
+
+// imageStillValid checks that a previously built image is still usable:
+// present in the local daemon, or, when pushing, resolvable in the registry.
+func (b *Builder) imageStillValid(ctx context.Context, digestOrImageID string) bool {
+	if b.pushImages {
+		return b.localDocker.ImageRemoteDigest(ctx, digestOrImageID) != ""
+	}
+	return b.localDocker.ImageExists(ctx, digestOrImageID)
+}
+
+// hashArtifact computes a stable hash over everything that can change the
+// bytes of the resulting image: the artifact spec itself, the contents of
+// every file it depends on, the base image it's currently built on top of,
+// and the output timestamp mode, since buildArtifactWithCache caches the
+// fully processed (post-timestamp-rewrite) result. Any change to one of
+// these invalidates the cache entry.
+func (b *Builder) hashArtifact(ctx context.Context, artifact *latest.Artifact) (string, error) {
+	deps, err := b.DependenciesForArtifact(ctx, artifact)
+	if err != nil {
+		return "", errors.Wrap(err, "getting dependencies")
+	}
+	sort.Strings(deps)
+
+	h := sha256.New()
+
+	spec, err := json.Marshal(artifact.ArtifactType)
+	if err != nil {
+		return "", err
+	}
+	h.Write(spec)
+	io.WriteString(h, b.outputTimestamp)
+
+	for _, dep := range deps {
+		io.WriteString(h, dep)
+		if err := hashFile(h, dep); err != nil {
+			return "", errors.Wrapf(err, "hashing %s", dep)
+		}
+	}
+
+	if artifact.DockerArtifact != nil {
+		baseDigest, err := b.localDocker.BaseImageDigest(ctx, artifact.Workspace, artifact.DockerArtifact)
+		if err == nil {
+			io.WriteString(h, baseDigest)
+		}
+	}
+
+	return hex.EncodeToString(h.Sum(nil)), nil
+}
+
+func hashFile(h io.Writer, path string) error {
+	f, err := os.Open(path)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return nil
+		}
+		return err
+	}
+	defer f.Close()
+
+	_, err = io.Copy(h, f)
+	return err
+}
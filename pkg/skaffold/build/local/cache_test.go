@@ -0,0 +1,139 @@
+/*
+Copyright 2019 The Skaffold Authors
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package local
+
+import (
+	"context"
+	"sync"
+	"testing"
+
+	"github.com/GoogleContainerTools/skaffold/pkg/skaffold/schema/latest"
+)
+
+func TestBuildCacheLookupMiss(t *testing.T) {
+	c, err := newBuildCacheAt(t.TempDir())
+	if err != nil {
+		t.Fatalf("newBuildCacheAt: %v", err)
+	}
+
+	if _, found := c.lookup("my-image", "somehash"); found {
+		t.Fatal("expected no entry in an empty cache")
+	}
+}
+
+func TestBuildCacheStoreThenLookup(t *testing.T) {
+	c, err := newBuildCacheAt(t.TempDir())
+	if err != nil {
+		t.Fatalf("newBuildCacheAt: %v", err)
+	}
+
+	if err := c.store("my-image", "hash1", "sha256:abc"); err != nil {
+		t.Fatalf("store: %v", err)
+	}
+
+	imageID, found := c.lookup("my-image", "hash1")
+	if !found {
+		t.Fatal("expected a cache hit")
+	}
+	if imageID != "sha256:abc" {
+		t.Fatalf("got imageID %q, want %q", imageID, "sha256:abc")
+	}
+
+	if _, found := c.lookup("my-image", "hash2"); found {
+		t.Fatal("expected a miss once the hash changes")
+	}
+}
+
+func TestBuildCacheStoreSurvivesReload(t *testing.T) {
+	dir := t.TempDir()
+
+	c, err := newBuildCacheAt(dir)
+	if err != nil {
+		t.Fatalf("newBuildCacheAt: %v", err)
+	}
+	if err := c.store("my-image", "hash1", "sha256:abc"); err != nil {
+		t.Fatalf("store: %v", err)
+	}
+
+	reloaded, err := newBuildCacheAt(dir)
+	if err != nil {
+		t.Fatalf("newBuildCacheAt (reload): %v", err)
+	}
+	if imageID, found := reloaded.lookup("my-image", "hash1"); !found || imageID != "sha256:abc" {
+		t.Fatalf("got (%q, %v), want (%q, true)", imageID, found, "sha256:abc")
+	}
+}
+
+func TestHashArtifactChangesWithOutputTimestamp(t *testing.T) {
+	artifact := &latest.Artifact{
+		ImageName:    "my-image",
+		ArtifactType: latest.ArtifactType{CustomArtifact: &latest.CustomArtifact{}},
+	}
+
+	bDefault := &Builder{outputTimestamp: ""}
+	bZero := &Builder{outputTimestamp: OutputTimestampZero}
+
+	hashDefault, err := bDefault.hashArtifact(context.Background(), artifact)
+	if err != nil {
+		t.Fatalf("hashArtifact (default): %v", err)
+	}
+	hashZero, err := bZero.hashArtifact(context.Background(), artifact)
+	if err != nil {
+		t.Fatalf("hashArtifact (zero): %v", err)
+	}
+
+	if hashDefault == hashZero {
+		t.Fatal("expected hashArtifact to change when outputTimestamp changes, since the cache stores the post-rewrite result")
+	}
+}
+
+func TestBuildCacheConcurrentStore(t *testing.T) {
+	dir := t.TempDir()
+
+	c, err := newBuildCacheAt(dir)
+	if err != nil {
+		t.Fatalf("newBuildCacheAt: %v", err)
+	}
+
+	var wg sync.WaitGroup
+	for i := 0; i < 20; i++ {
+		i := i
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			imageName := string(rune('a' + i))
+			if err := c.store(imageName, "hash", "sha256:"+imageName); err != nil {
+				t.Errorf("store: %v", err)
+			}
+		}()
+	}
+	wg.Wait()
+
+	// Reload from disk: the in-memory map always holds every entry, so only
+	// the persisted file can show writes that clobbered each other.
+	reloaded, err := newBuildCacheAt(dir)
+	if err != nil {
+		t.Fatalf("newBuildCacheAt (reload): %v", err)
+	}
+
+	for i := 0; i < 20; i++ {
+		imageName := string(rune('a' + i))
+		if _, found := reloaded.lookup(imageName, "hash"); !found {
+			t.Errorf("entry for %q lost, concurrent stores likely interleaved their writes", imageName)
+		}
+	}
+}
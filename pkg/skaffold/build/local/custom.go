@@ -0,0 +1,146 @@
+/*
+Copyright 2019 The Skaffold Authors
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package local
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"encoding/json"
+	"io"
+	"os"
+	"os/exec"
+	"strings"
+
+	"github.com/GoogleContainerTools/skaffold/pkg/skaffold/schema/latest"
+	"github.com/pkg/errors"
+)
+
+// customArtifactBuilderOutput is the one JSON line a CustomArtifact command
+// is expected to print to stdout once it's done: either the imageID of an
+// image it loaded into the local daemon, or the digest of one it pushed
+// itself.
+type customArtifactBuilderOutput struct {
+	ImageID string `json:"imageID"`
+	Digest  string `json:"digest"`
+}
+
+// customArtifactBuilder runs a CustomArtifact's build and dependencies
+// commands as external processes. This is what lets Skaffold build with
+// Buildpacks, ko, nixpkgs2container or any other tool that can be driven
+// from a shell command, without Skaffold knowing anything about them.
+type customArtifactBuilder struct{}
+
+func (customArtifactBuilder) Build(ctx context.Context, out io.Writer, a *latest.Artifact, tag string) (string, error) {
+	custom := a.CustomArtifact
+	if strings.TrimSpace(custom.BuildCommand) == "" {
+		return "", errors.Errorf("no build command set for custom artifact [%s]", a.ImageName)
+	}
+
+	args := templateArgs(custom.BuildCommand, map[string]string{"IMAGE": tag})
+	cmd := exec.CommandContext(ctx, args[0], args[1:]...)
+	cmd.Dir = a.Workspace
+	// Start from the process environment, not cmd.Env's zero value: Env is
+	// nil here, and append(nil, ...) allocates a brand new one-element
+	// slice rather than extending "inherit the parent's environment",
+	// which would strip PATH, HOME, and any Docker/registry credential
+	// helper configuration the build command needs.
+	cmd.Env = append(os.Environ(), "IMAGE="+tag)
+
+	var combined bytes.Buffer
+	cmd.Stdout = io.MultiWriter(out, &combined)
+	cmd.Stderr = out
+
+	if err := cmd.Run(); err != nil {
+		return "", errors.Wrapf(err, "running custom build command for [%s]", a.ImageName)
+	}
+
+	output, err := lastJSONLine(combined.String())
+	if err != nil {
+		return "", errors.Wrapf(err, "parsing custom builder output for [%s]", a.ImageName)
+	}
+
+	if output.Digest != "" {
+		return output.Digest, nil
+	}
+	if output.ImageID != "" {
+		return output.ImageID, nil
+	}
+
+	return "", errors.Errorf("custom build command for [%s] printed neither an imageID nor a digest", a.ImageName)
+}
+
+func (customArtifactBuilder) Dependencies(ctx context.Context, a *latest.Artifact) ([]string, error) {
+	custom := a.CustomArtifact
+	if strings.TrimSpace(custom.DependenciesCommand) == "" {
+		return nil, nil
+	}
+
+	args := templateArgs(custom.DependenciesCommand, nil)
+	cmd := exec.CommandContext(ctx, args[0], args[1:]...)
+	cmd.Dir = a.Workspace
+
+	stdout, err := cmd.Output()
+	if err != nil {
+		return nil, errors.Wrapf(err, "running custom dependencies command for [%s]", a.ImageName)
+	}
+
+	var paths []string
+	scanner := bufio.NewScanner(bytes.NewReader(stdout))
+	for scanner.Scan() {
+		if line := strings.TrimSpace(scanner.Text()); line != "" {
+			paths = append(paths, line)
+		}
+	}
+
+	return paths, nil
+}
+
+// templateArgs splits a command template on whitespace and substitutes any
+// $KEY placeholders from vars, keeping the contract dead simple: no shell,
+// no quoting rules to get wrong, just a command and its arguments.
+func templateArgs(command string, vars map[string]string) []string {
+	fields := strings.Fields(command)
+	for i, f := range fields {
+		for k, v := range vars {
+			f = strings.ReplaceAll(f, "$"+k, v)
+		}
+		fields[i] = f
+	}
+	return fields
+}
+
+// lastJSONLine returns the last non-empty line of output decoded as a
+// customArtifactBuilderOutput, so a plugin is free to log progress to
+// stdout as long as its final line is the JSON result.
+func lastJSONLine(output string) (customArtifactBuilderOutput, error) {
+	lines := strings.Split(strings.TrimRight(output, "\n"), "\n")
+	for i := len(lines) - 1; i >= 0; i-- {
+		line := strings.TrimSpace(lines[i])
+		if line == "" {
+			continue
+		}
+
+		var out customArtifactBuilderOutput
+		if err := json.Unmarshal([]byte(line), &out); err != nil {
+			return customArtifactBuilderOutput{}, err
+		}
+		return out, nil
+	}
+
+	return customArtifactBuilderOutput{}, errors.New("no output")
+}
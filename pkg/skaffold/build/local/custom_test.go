@@ -0,0 +1,102 @@
+/*
+Copyright 2019 The Skaffold Authors
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package local
+
+import (
+	"context"
+	"testing"
+
+	"github.com/GoogleContainerTools/skaffold/pkg/skaffold/schema/latest"
+)
+
+func TestLastJSONLineImageID(t *testing.T) {
+	out, err := lastJSONLine("building...\n{\"imageID\":\"sha256:abc\"}\n")
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if out.ImageID != "sha256:abc" {
+		t.Fatalf("got imageID %q, want %q", out.ImageID, "sha256:abc")
+	}
+}
+
+func TestLastJSONLineTrailingBlankLines(t *testing.T) {
+	out, err := lastJSONLine("{\"digest\":\"sha256:def\"}\n\n\n")
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if out.Digest != "sha256:def" {
+		t.Fatalf("got digest %q, want %q", out.Digest, "sha256:def")
+	}
+}
+
+func TestLastJSONLineNoOutput(t *testing.T) {
+	if _, err := lastJSONLine("   \n"); err == nil {
+		t.Fatal("expected an error for output with no JSON line")
+	}
+}
+
+func TestCustomArtifactBuilderBuildEmptyCommand(t *testing.T) {
+	a := &latest.Artifact{
+		ImageName:    "my-image",
+		ArtifactType: latest.ArtifactType{CustomArtifact: &latest.CustomArtifact{}},
+	}
+
+	if _, err := (customArtifactBuilder{}).Build(context.Background(), nil, a, "my-image:tag"); err == nil {
+		t.Fatal("expected an error instead of indexing into an empty argument list")
+	}
+}
+
+func TestCustomArtifactBuilderBuildWhitespaceCommand(t *testing.T) {
+	a := &latest.Artifact{
+		ImageName:    "my-image",
+		ArtifactType: latest.ArtifactType{CustomArtifact: &latest.CustomArtifact{BuildCommand: "   "}},
+	}
+
+	if _, err := (customArtifactBuilder{}).Build(context.Background(), nil, a, "my-image:tag"); err == nil {
+		t.Fatal("expected an error instead of indexing into an empty argument list")
+	}
+}
+
+func TestCustomArtifactBuilderDependenciesEmptyCommand(t *testing.T) {
+	a := &latest.Artifact{
+		ImageName:    "my-image",
+		ArtifactType: latest.ArtifactType{CustomArtifact: &latest.CustomArtifact{}},
+	}
+
+	deps, err := (customArtifactBuilder{}).Dependencies(context.Background(), a)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if deps != nil {
+		t.Fatalf("got %v, want nil", deps)
+	}
+}
+
+func TestCustomArtifactBuilderDependenciesWhitespaceCommand(t *testing.T) {
+	a := &latest.Artifact{
+		ImageName:    "my-image",
+		ArtifactType: latest.ArtifactType{CustomArtifact: &latest.CustomArtifact{DependenciesCommand: "   "}},
+	}
+
+	deps, err := (customArtifactBuilder{}).Dependencies(context.Background(), a)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if deps != nil {
+		t.Fatalf("got %v, want nil", deps)
+	}
+}
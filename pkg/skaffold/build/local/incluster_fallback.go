@@ -0,0 +1,389 @@
+/*
+Copyright 2019 The Skaffold Authors
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package local
+
+import (
+	"archive/tar"
+	"bufio"
+	"context"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	skfdkubernetes "github.com/GoogleContainerTools/skaffold/pkg/skaffold/kubernetes"
+	"github.com/GoogleContainerTools/skaffold/pkg/skaffold/schema/latest"
+	"github.com/pkg/errors"
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/resource"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/kubernetes"
+	"k8s.io/client-go/kubernetes/scheme"
+	"k8s.io/client-go/rest"
+	"k8s.io/client-go/tools/remotecommand"
+)
+
+const (
+	// defaultInClusterBuilderImage is used when the artifact doesn't override
+	// it via its own `inClusterBuilderImage` field.
+	defaultInClusterBuilderImage = "gcr.io/kaniko-project/executor:latest"
+
+	inClusterBuildTimeout = 20 * time.Minute
+	contextVolumeName     = "build-context"
+	digestFile            = "/workspace/.skaffold-digest"
+)
+
+// dockerDaemonAvailable reports whether the local Docker daemon can be
+// reached. The result is cached on the Builder itself: pinging the daemon
+// is only worth doing once per `skaffold dev` session, not once per
+// artifact, and caching it on the Builder (rather than package-level)
+// means a different Builder, or a retry after the daemon comes back up,
+// isn't stuck with a stale answer from some other run.
+func (b *Builder) dockerDaemonAvailable(ctx context.Context) bool {
+	b.dockerPingOnce.Do(func() {
+		pingCtx, cancel := context.WithTimeout(ctx, 2*time.Second)
+		defer cancel()
+
+		if err := b.localDocker.Ping(pingCtx); err != nil {
+			b.dockerUnreachable = true
+		}
+	})
+
+	return !b.dockerUnreachable
+}
+
+// buildInCluster runs a Kaniko build pod against the current kubeContext and
+// streams its logs to out. This lets `skaffold dev` keep working on
+// Docker-less setups (Podman, rootless, CI runners with no
+// /var/run/docker.sock) without switching the whole project over to the
+// cluster builder profile.
+func (b *Builder) buildInCluster(ctx context.Context, out io.Writer, artifact *latest.Artifact, tag string) (string, error) {
+	if artifact.DockerArtifact == nil {
+		return "", fmt.Errorf("in-cluster fallback only supports Docker artifacts, got: %+v", artifact.ArtifactType)
+	}
+
+	client, err := skfdkubernetes.Client()
+	if err != nil {
+		return "", errors.Wrap(err, "getting kubernetes client")
+	}
+	restConfig, err := skfdkubernetes.RESTConfig()
+	if err != nil {
+		return "", errors.Wrap(err, "getting kubernetes REST config")
+	}
+	ns := b.namespace
+
+	name := fmt.Sprintf("skaffold-in-cluster-build-%s", sanitizeForPodName(artifact.ImageName))
+
+	pvc := buildContextPVC(name)
+	if _, err := client.CoreV1().PersistentVolumeClaims(ns).Create(pvc); err != nil {
+		return "", errors.Wrap(err, "creating build context volume")
+	}
+	defer client.CoreV1().PersistentVolumeClaims(ns).Delete(name, &metav1.DeleteOptions{})
+
+	builderImage := defaultInClusterBuilderImage
+	if artifact.InClusterBuilderImage != "" {
+		builderImage = artifact.InClusterBuilderImage
+	}
+
+	pod := inClusterBuilderPod(name, builderImage, artifact.DockerArtifact, tag)
+	if _, err := client.CoreV1().Pods(ns).Create(pod); err != nil {
+		return "", errors.Wrap(err, "creating build pod")
+	}
+	defer client.CoreV1().Pods(ns).Delete(name, &metav1.DeleteOptions{})
+
+	if err := waitForContainerRunning(ctx, client, ns, name, "upload-context"); err != nil {
+		return "", errors.Wrap(err, "waiting for build pod to be ready for upload")
+	}
+
+	// Attaches to the upload-context container's own entrypoint (a bare
+	// `tar -xf -`) and feeds it the workspace tar over its real stdin, the
+	// same way `kubectl attach` would. The container then exits on its own
+	// once the tar stream reaches EOF, letting the init container sequence
+	// complete and the build container start.
+	if err := uploadWorkspace(restConfig, client, ns, name, "upload-context", artifact.Workspace); err != nil {
+		return "", errors.Wrap(err, "uploading build context")
+	}
+
+	if err := waitForPodSucceeded(ctx, client, ns, name, inClusterBuildTimeout); err != nil {
+		streamPodLogs(client, ns, name, out)
+		return "", errors.Wrap(err, "waiting for build pod to complete")
+	}
+
+	streamPodLogs(client, ns, name, out)
+
+	// The build container has already exited by this point, so its digest
+	// can't be read with an exec — Kubernetes refuses to exec into a
+	// terminated container. Kaniko's --digest-file is instead pointed at
+	// the container's termination message path, so the digest rides along
+	// on the pod status that waitForPodSucceeded already fetched.
+	digest, err := readDigestFromStatus(client, ns, name)
+	if err != nil {
+		return "", errors.Wrap(err, "reading resulting digest")
+	}
+
+	return digest, nil
+}
+
+// buildContextPVC provisions a scratch volume that the upload-context init
+// container fills with a tar of the workspace, and that the builder
+// container then reads the Dockerfile context from.
+func buildContextPVC(name string) *corev1.PersistentVolumeClaim {
+	return &corev1.PersistentVolumeClaim{
+		ObjectMeta: metav1.ObjectMeta{Name: name},
+		Spec: corev1.PersistentVolumeClaimSpec{
+			AccessModes: []corev1.PersistentVolumeAccessMode{corev1.ReadWriteOnce},
+			Resources: corev1.ResourceRequirements{
+				Requests: corev1.ResourceList{corev1.ResourceStorage: resource.MustParse("1Gi")},
+			},
+		},
+	}
+}
+
+// inClusterBuilderPod describes a pod with two phases: an init container
+// whose own entrypoint is the tar extraction uploadWorkspace attaches to
+// directly, and the Kaniko container that consumes the result once
+// populated. The digest of the pushed image is written to digestFile and
+// surfaced through the build container's termination message, so the
+// caller can read it back from the pod status instead of execing into an
+// already-exited container.
+//
+// Kaniko always pushes here, regardless of the top-level pushImages
+// setting: the pod and its backing volume are deleted as soon as the
+// digest is read, so a --no-push build's layers would exist nowhere
+// pullable once buildInCluster returns. There's no local daemon to load
+// them into either — a local daemon being unavailable is the whole reason
+// this fallback runs in the first place.
+func inClusterBuilderPod(name, builderImage string, a *latest.DockerArtifact, tag string) *corev1.Pod {
+	args := []string{
+		"--dockerfile=" + a.DockerfilePath,
+		"--context=dir:///workspace",
+		"--digest-file=" + digestFile,
+		"--destination=" + tag,
+	}
+	for k, v := range a.BuildArgs {
+		if v != nil {
+			args = append(args, fmt.Sprintf("--build-arg=%s=%s", k, *v))
+		}
+	}
+
+	return &corev1.Pod{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:   name,
+			Labels: map[string]string{"skaffold.dev/in-cluster-build": "true"},
+		},
+		Spec: corev1.PodSpec{
+			RestartPolicy: corev1.RestartPolicyNever,
+			InitContainers: []corev1.Container{{
+				Name:         "upload-context",
+				Image:        "busybox",
+				Command:      []string{"tar", "-C", "/workspace", "-xf", "-"},
+				Stdin:        true,
+				StdinOnce:    true,
+				VolumeMounts: []corev1.VolumeMount{{Name: contextVolumeName, MountPath: "/workspace"}},
+			}},
+			Containers: []corev1.Container{{
+				Name:                   "build",
+				Image:                  builderImage,
+				Args:                   args,
+				VolumeMounts:           []corev1.VolumeMount{{Name: contextVolumeName, MountPath: "/workspace"}},
+				TerminationMessagePath: digestFile,
+			}},
+			Volumes: []corev1.Volume{{
+				Name: contextVolumeName,
+				VolumeSource: corev1.VolumeSource{
+					PersistentVolumeClaim: &corev1.PersistentVolumeClaimVolumeSource{ClaimName: name},
+				},
+			}},
+		},
+	}
+}
+
+// uploadWorkspace streams workspace as a tar into the init container's real
+// stdin by attaching to its already-running process (the container's own
+// Command is `tar -C /workspace -xf -`), the same mechanism `kubectl
+// attach` uses. Execing a brand new process instead, as an earlier version
+// of this code did, would stream into a process that was never connected
+// to the container's entrypoint and so would write nothing to disk.
+func uploadWorkspace(restConfig *rest.Config, client kubernetes.Interface, ns, pod, container, workspace string) error {
+	req := client.CoreV1().RESTClient().Post().
+		Resource("pods").
+		Name(pod).
+		Namespace(ns).
+		SubResource("attach")
+	req.VersionedParams(&corev1.PodAttachOptions{
+		Container: container,
+		Stdin:     true,
+	}, scheme.ParameterCodec)
+
+	attach, err := remotecommand.NewSPDYExecutor(restConfig, "POST", req.URL())
+	if err != nil {
+		return err
+	}
+
+	pr, pw := io.Pipe()
+	go func() {
+		tw := tar.NewWriter(pw)
+		pw.CloseWithError(addWorkspaceToTar(tw, workspace))
+	}()
+
+	return attach.Stream(remotecommand.StreamOptions{Stdin: pr})
+}
+
+func addWorkspaceToTar(tw *tar.Writer, workspace string) error {
+	defer tw.Close()
+
+	return filepath.Walk(workspace, func(path string, info os.FileInfo, err error) error {
+		if err != nil || info.IsDir() {
+			return err
+		}
+
+		rel, err := filepath.Rel(workspace, path)
+		if err != nil {
+			return err
+		}
+
+		hdr, err := tar.FileInfoHeader(info, "")
+		if err != nil {
+			return err
+		}
+		hdr.Name = rel
+
+		if err := tw.WriteHeader(hdr); err != nil {
+			return err
+		}
+
+		f, err := os.Open(path)
+		if err != nil {
+			return err
+		}
+		defer f.Close()
+
+		_, err = io.Copy(tw, f)
+		return err
+	})
+}
+
+// readDigestFromStatus reads the digest Kaniko wrote to digestFile back out
+// of the build container's termination message, which Kubernetes populates
+// from that same file once the container exits. This avoids execing into a
+// container that has, by the time the pod is Succeeded, already terminated
+// and can no longer accept exec sessions.
+func readDigestFromStatus(client kubernetes.Interface, ns, pod string) (string, error) {
+	p, err := client.CoreV1().Pods(ns).Get(pod, metav1.GetOptions{})
+	if err != nil {
+		return "", err
+	}
+
+	for _, cs := range p.Status.ContainerStatuses {
+		if cs.Name != "build" || cs.State.Terminated == nil {
+			continue
+		}
+		if digest := strings.TrimSpace(cs.State.Terminated.Message); digest != "" {
+			return digest, nil
+		}
+		return "", errors.New("build container exited without writing a digest")
+	}
+
+	return "", errors.New("build container status not found")
+}
+
+func streamPodLogs(client kubernetes.Interface, ns, pod string, out io.Writer) {
+	req := client.CoreV1().Pods(ns).GetLogs(pod, &corev1.PodLogOptions{Container: "build", Follow: true})
+	stream, err := req.Stream()
+	if err != nil {
+		return
+	}
+	defer stream.Close()
+
+	scanner := bufio.NewScanner(stream)
+	for scanner.Scan() {
+		fmt.Fprintln(out, scanner.Text())
+	}
+}
+
+func waitForContainerRunning(ctx context.Context, client kubernetes.Interface, ns, pod, container string) error {
+	return wait(ctx, 2*time.Minute, func() (bool, error) {
+		p, err := client.CoreV1().Pods(ns).Get(pod, metav1.GetOptions{})
+		if err != nil {
+			return false, err
+		}
+		for _, s := range p.Status.InitContainerStatuses {
+			if s.Name == container && s.State.Running != nil {
+				return true, nil
+			}
+		}
+		return false, nil
+	})
+}
+
+func waitForPodSucceeded(ctx context.Context, client kubernetes.Interface, ns, pod string, timeout time.Duration) error {
+	return wait(ctx, timeout, func() (bool, error) {
+		p, err := client.CoreV1().Pods(ns).Get(pod, metav1.GetOptions{})
+		if err != nil {
+			return false, err
+		}
+		switch p.Status.Phase {
+		case corev1.PodSucceeded:
+			return true, nil
+		case corev1.PodFailed:
+			return false, fmt.Errorf("build pod %s failed", pod)
+		default:
+			return false, nil
+		}
+	})
+}
+
+func wait(ctx context.Context, timeout time.Duration, condition func() (bool, error)) error {
+	ctx, cancel := context.WithTimeout(ctx, timeout)
+	defer cancel()
+
+	ticker := time.NewTicker(time.Second)
+	defer ticker.Stop()
+
+	for {
+		done, err := condition()
+		if err != nil {
+			return err
+		}
+		if done {
+			return nil
+		}
+
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-ticker.C:
+		}
+	}
+}
+
+func sanitizeForPodName(imageName string) string {
+	out := make([]rune, 0, len(imageName))
+	for _, r := range imageName {
+		switch {
+		case r >= 'a' && r <= 'z', r >= '0' && r <= '9':
+			out = append(out, r)
+		case r >= 'A' && r <= 'Z':
+			out = append(out, r-'A'+'a')
+		default:
+			out = append(out, '-')
+		}
+	}
+	return string(out)
+}
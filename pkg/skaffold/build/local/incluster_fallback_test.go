@@ -0,0 +1,86 @@
+/*
+Copyright 2019 The Skaffold Authors
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package local
+
+import (
+	"testing"
+
+	"github.com/GoogleContainerTools/skaffold/pkg/skaffold/schema/latest"
+)
+
+func TestSanitizeForPodName(t *testing.T) {
+	tests := []struct {
+		imageName string
+		want      string
+	}{
+		{"gcr.io/my-project/My-App", "gcr-io-my-project-my-app"},
+		{"simple", "simple"},
+		{"UPPER_CASE", "upper-case"},
+	}
+
+	for _, test := range tests {
+		if got := sanitizeForPodName(test.imageName); got != test.want {
+			t.Errorf("sanitizeForPodName(%q) = %q, want %q", test.imageName, got, test.want)
+		}
+	}
+}
+
+func TestInClusterBuilderPodUsesDigestFileAndTerminationMessage(t *testing.T) {
+	a := &latest.DockerArtifact{DockerfilePath: "Dockerfile"}
+
+	pod := inClusterBuilderPod("my-build", "", a, "my-image:tag")
+
+	build := pod.Spec.Containers[0]
+	if build.TerminationMessagePath != digestFile {
+		t.Fatalf("expected TerminationMessagePath %q, got %q", digestFile, build.TerminationMessagePath)
+	}
+
+	found := false
+	for _, arg := range build.Args {
+		if arg == "--digest-file="+digestFile {
+			found = true
+		}
+	}
+	if !found {
+		t.Fatalf("expected --digest-file=%s in args, got %v", digestFile, build.Args)
+	}
+
+	init := pod.Spec.InitContainers[0]
+	if len(init.Command) == 0 || init.Command[0] != "tar" {
+		t.Fatalf("expected the init container's own entrypoint to be the tar extraction, got %v", init.Command)
+	}
+}
+
+func TestInClusterBuilderPodAlwaysPushes(t *testing.T) {
+	a := &latest.DockerArtifact{DockerfilePath: "Dockerfile"}
+
+	pod := inClusterBuilderPod("my-build", "", a, "my-image:tag")
+
+	build := pod.Spec.Containers[0]
+	found := false
+	for _, arg := range build.Args {
+		if arg == "--no-push" {
+			t.Fatalf("expected no --no-push arg: the pod and its volume are deleted as soon as the digest is read, so a non-pushed image would be unpullable from anywhere")
+		}
+		if arg == "--destination=my-image:tag" {
+			found = true
+		}
+	}
+	if !found {
+		t.Fatalf("expected --destination=my-image:tag in args, got %v", build.Args)
+	}
+}
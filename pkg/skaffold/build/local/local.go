@@ -18,16 +18,12 @@ package local
 
 import (
 	"context"
-	"fmt"
 	"io"
 	"strings"
 
-	"github.com/GoogleContainerTools/skaffold/pkg/skaffold/bazel"
 	"github.com/GoogleContainerTools/skaffold/pkg/skaffold/build"
 	"github.com/GoogleContainerTools/skaffold/pkg/skaffold/build/tag"
 	"github.com/GoogleContainerTools/skaffold/pkg/skaffold/color"
-	"github.com/GoogleContainerTools/skaffold/pkg/skaffold/docker"
-	"github.com/GoogleContainerTools/skaffold/pkg/skaffold/jib"
 	"github.com/GoogleContainerTools/skaffold/pkg/skaffold/schema/latest"
 	"github.com/GoogleContainerTools/skaffold/pkg/skaffold/util"
 	"github.com/pkg/errors"
@@ -42,17 +38,28 @@ func (b *Builder) Build(ctx context.Context, out io.Writer, tags tag.ImageTags,
 	}
 	defer b.localDocker.Close()
 
-	// TODO(dgageot): parallel builds
-	return build.InSequence(ctx, out, tags, artifacts, b.buildArtifact)
+	if b.concurrency == 1 {
+		return build.InSequence(ctx, out, tags, artifacts, b.buildArtifact)
+	}
+	return b.buildArtifactsInParallel(ctx, out, tags, artifacts, b.buildArtifact)
 }
 
 func (b *Builder) buildArtifact(ctx context.Context, out io.Writer, artifact *latest.Artifact, tag string) (string, error) {
-	digestOrImageID, err := b.runBuildForArtifact(ctx, out, artifact, tag)
+	build := b.buildAndRewrite
+	if b.cache != nil {
+		build = b.buildArtifactWithCache
+	}
+
+	digestOrImageID, err := build(ctx, out, artifact, tag)
 	if err != nil {
 		return "", errors.Wrap(err, "build artifact")
 	}
 
-	if b.pushImages {
+	// An in-cluster Kaniko build always pushes: the build pod and its
+	// backing volume are torn down as soon as the digest is read, and
+	// there's no local daemon to load the image into either, so
+	// digestOrImageID is a pushed digest regardless of b.pushImages.
+	if b.pushImages || b.builtInCluster(ctx, artifact) {
 		digest := digestOrImageID
 		return tag + "@" + digest, nil
 	}
@@ -70,48 +77,56 @@ func (b *Builder) buildArtifact(ctx context.Context, out io.Writer, artifact *la
 	return uniqueTag, nil
 }
 
-func (b *Builder) runBuildForArtifact(ctx context.Context, out io.Writer, artifact *latest.Artifact, tag string) (string, error) {
-	switch {
-	case artifact.DockerArtifact != nil:
-		return b.buildDocker(ctx, out, artifact.Workspace, artifact.DockerArtifact, tag)
-
-	case artifact.BazelArtifact != nil:
-		return b.buildBazel(ctx, out, artifact.Workspace, artifact.BazelArtifact, tag)
-
-	case artifact.JibMavenArtifact != nil:
-		return b.buildJibMaven(ctx, out, artifact.Workspace, artifact.JibMavenArtifact, tag)
-
-	case artifact.JibGradleArtifact != nil:
-		return b.buildJibGradle(ctx, out, artifact.Workspace, artifact.JibGradleArtifact, tag)
+// buildAndRewrite runs the real build for an artifact and, if output
+// timestamps are configured, rewrites the resulting image's created time.
+// This is the uncached path, and also what buildArtifactWithCache wraps, so
+// that a cache hit and a cache miss produce an identically processed result.
+func (b *Builder) buildAndRewrite(ctx context.Context, out io.Writer, artifact *latest.Artifact, tag string) (string, error) {
+	digestOrImageID, err := b.runBuildForArtifact(ctx, out, artifact, tag)
+	if err != nil {
+		return "", err
+	}
 
-	default:
-		return "", fmt.Errorf("undefined artifact type: %+v", artifact.ArtifactType)
+	if b.outputTimestamp == "" {
+		return digestOrImageID, nil
 	}
-}
 
-func (b *Builder) DependenciesForArtifact(ctx context.Context, a *latest.Artifact) ([]string, error) {
-	var (
-		paths []string
-		err   error
-	)
+	return b.rewriteImageTimestamp(ctx, artifact, digestOrImageID)
+}
 
-	switch {
-	case a.DockerArtifact != nil:
-		paths, err = docker.GetDependencies(ctx, a.Workspace, a.DockerArtifact)
+func (b *Builder) runBuildForArtifact(ctx context.Context, out io.Writer, artifact *latest.Artifact, tag string) (string, error) {
+	if b.builtInCluster(ctx, artifact) {
+		if artifact.PreferInCluster {
+			color.Yellow.Fprintf(out, "[%s] is configured to prefer in-cluster builds, building in-cluster.\n", artifact.ImageName)
+		} else {
+			color.Yellow.Fprintf(out, "No local Docker daemon available, building [%s] in-cluster.\n", artifact.ImageName)
+		}
+		return b.buildInCluster(ctx, out, artifact, tag)
+	}
 
-	case a.BazelArtifact != nil:
-		paths, err = bazel.GetDependencies(ctx, a.Workspace, a.BazelArtifact)
+	builder, err := artifactBuilderFor(b, artifact)
+	if err != nil {
+		return "", err
+	}
 
-	case a.JibMavenArtifact != nil:
-		paths, err = jib.GetDependenciesMaven(ctx, a.Workspace, a.JibMavenArtifact)
+	return builder.Build(ctx, out, artifact, tag)
+}
 
-	case a.JibGradleArtifact != nil:
-		paths, err = jib.GetDependenciesGradle(ctx, a.Workspace, a.JibGradleArtifact)
+// builtInCluster reports whether artifact will be (or was) built with the
+// in-cluster Kaniko fallback rather than a local builder, either because
+// the artifact opted into it explicitly or because no local Docker daemon
+// could be reached.
+func (b *Builder) builtInCluster(ctx context.Context, artifact *latest.Artifact) bool {
+	return artifact.PreferInCluster || !b.dockerDaemonAvailable(ctx)
+}
 
-	default:
-		return nil, fmt.Errorf("undefined artifact type: %+v", a.ArtifactType)
+func (b *Builder) DependenciesForArtifact(ctx context.Context, a *latest.Artifact) ([]string, error) {
+	builder, err := artifactBuilderFor(b, a)
+	if err != nil {
+		return nil, err
 	}
 
+	paths, err := builder.Dependencies(ctx, a)
 	if err != nil {
 		// if the context was cancelled act as if all is well
 		// TODO(dgageot): this should be even higher in the call chain.
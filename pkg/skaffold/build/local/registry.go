@@ -0,0 +1,101 @@
+/*
+Copyright 2019 The Skaffold Authors
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package local
+
+import (
+	"context"
+	"fmt"
+	"io"
+
+	"github.com/GoogleContainerTools/skaffold/pkg/skaffold/bazel"
+	"github.com/GoogleContainerTools/skaffold/pkg/skaffold/docker"
+	"github.com/GoogleContainerTools/skaffold/pkg/skaffold/jib"
+	"github.com/GoogleContainerTools/skaffold/pkg/skaffold/schema/latest"
+)
+
+// ArtifactBuilder builds one artifact type and lists the files it depends
+// on. It's the extension point that lets new artifact types, whether
+// built into Skaffold or supplied through a CustomArtifact command, plug
+// into the local builder the same way.
+type ArtifactBuilder interface {
+	Build(ctx context.Context, out io.Writer, artifact *latest.Artifact, tag string) (string, error)
+	Dependencies(ctx context.Context, artifact *latest.Artifact) ([]string, error)
+}
+
+// artifactBuilderFor returns the ArtifactBuilder registered for a's
+// discriminated artifact type.
+func artifactBuilderFor(b *Builder, a *latest.Artifact) (ArtifactBuilder, error) {
+	switch {
+	case a.DockerArtifact != nil:
+		return dockerArtifactBuilder{b}, nil
+
+	case a.BazelArtifact != nil:
+		return bazelArtifactBuilder{b}, nil
+
+	case a.JibMavenArtifact != nil:
+		return jibMavenArtifactBuilder{b}, nil
+
+	case a.JibGradleArtifact != nil:
+		return jibGradleArtifactBuilder{b}, nil
+
+	case a.CustomArtifact != nil:
+		return customArtifactBuilder{}, nil
+
+	default:
+		return nil, fmt.Errorf("undefined artifact type: %+v", a.ArtifactType)
+	}
+}
+
+type dockerArtifactBuilder struct{ b *Builder }
+
+func (d dockerArtifactBuilder) Build(ctx context.Context, out io.Writer, a *latest.Artifact, tag string) (string, error) {
+	return d.b.buildDocker(ctx, out, a.Workspace, a.DockerArtifact, tag)
+}
+
+func (d dockerArtifactBuilder) Dependencies(ctx context.Context, a *latest.Artifact) ([]string, error) {
+	return docker.GetDependencies(ctx, a.Workspace, a.DockerArtifact)
+}
+
+type bazelArtifactBuilder struct{ b *Builder }
+
+func (d bazelArtifactBuilder) Build(ctx context.Context, out io.Writer, a *latest.Artifact, tag string) (string, error) {
+	return d.b.buildBazel(ctx, out, a.Workspace, a.BazelArtifact, tag)
+}
+
+func (d bazelArtifactBuilder) Dependencies(ctx context.Context, a *latest.Artifact) ([]string, error) {
+	return bazel.GetDependencies(ctx, a.Workspace, a.BazelArtifact)
+}
+
+type jibMavenArtifactBuilder struct{ b *Builder }
+
+func (d jibMavenArtifactBuilder) Build(ctx context.Context, out io.Writer, a *latest.Artifact, tag string) (string, error) {
+	return d.b.buildJibMaven(ctx, out, a.Workspace, a.JibMavenArtifact, tag)
+}
+
+func (d jibMavenArtifactBuilder) Dependencies(ctx context.Context, a *latest.Artifact) ([]string, error) {
+	return jib.GetDependenciesMaven(ctx, a.Workspace, a.JibMavenArtifact)
+}
+
+type jibGradleArtifactBuilder struct{ b *Builder }
+
+func (d jibGradleArtifactBuilder) Build(ctx context.Context, out io.Writer, a *latest.Artifact, tag string) (string, error) {
+	return d.b.buildJibGradle(ctx, out, a.Workspace, a.JibGradleArtifact, tag)
+}
+
+func (d jibGradleArtifactBuilder) Dependencies(ctx context.Context, a *latest.Artifact) ([]string, error) {
+	return jib.GetDependenciesGradle(ctx, a.Workspace, a.JibGradleArtifact)
+}
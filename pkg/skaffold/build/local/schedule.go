@@ -0,0 +1,229 @@
+/*
+Copyright 2019 The Skaffold Authors
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package local
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"io"
+	"sort"
+	"strings"
+	"sync"
+	"sync/atomic"
+
+	"github.com/GoogleContainerTools/skaffold/pkg/skaffold/build"
+	"github.com/GoogleContainerTools/skaffold/pkg/skaffold/build/tag"
+	"github.com/GoogleContainerTools/skaffold/pkg/skaffold/docker"
+	"github.com/GoogleContainerTools/skaffold/pkg/skaffold/schema/latest"
+	"github.com/pkg/errors"
+)
+
+// artifactNode is one artifact's place in the build DAG. An artifact depends
+// on another artifact in the same run when its Dockerfile's FROM resolves to
+// that artifact's image name.
+type artifactNode struct {
+	artifact *latest.Artifact
+	parents  []string
+	children []*artifactNode
+	pending  int32
+}
+
+// artifactBuildFunc builds a single artifact, the same shape as
+// Builder.buildArtifact. It's threaded through buildArtifactsInParallel as a
+// parameter, rather than called as a method directly, so tests can exercise
+// the scheduling behavior with a fake build that doesn't need a real Docker
+// daemon.
+type artifactBuildFunc func(ctx context.Context, out io.Writer, artifact *latest.Artifact, tag string) (string, error)
+
+// buildArtifactsInParallel builds artifacts with up to b.concurrency builds
+// running at once, starting each artifact as soon as the artifacts it
+// depends on have finished. A failing artifact cancels the artifacts that
+// depend on it, but unrelated branches of the graph still run to
+// completion. The returned slice is always in the same order as artifacts,
+// regardless of build or finish order.
+func (b *Builder) buildArtifactsInParallel(ctx context.Context, out io.Writer, tags tag.ImageTags, artifacts []*latest.Artifact, doBuild artifactBuildFunc) ([]build.Artifact, error) {
+	nodes, err := buildDependencyGraph(ctx, artifacts)
+	if err != nil {
+		return nil, err
+	}
+
+	concurrency := b.concurrency
+	if concurrency <= 0 || concurrency > len(artifacts) {
+		concurrency = len(artifacts)
+	}
+	sem := make(chan struct{}, concurrency)
+
+	var (
+		mu      sync.Mutex
+		wg      sync.WaitGroup
+		results = make(map[string]build.Artifact, len(artifacts))
+		errs    = make(map[string]error)
+	)
+
+	var schedule func(n *artifactNode)
+	schedule = func(n *artifactNode) {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+
+			mu.Lock()
+			var failedParent string
+			for _, p := range n.parents {
+				if errs[p] != nil {
+					failedParent = p
+					break
+				}
+			}
+			mu.Unlock()
+
+			if failedParent != "" {
+				mu.Lock()
+				errs[n.artifact.ImageName] = errors.Errorf("skipping build of [%s]: dependency [%s] failed to build", n.artifact.ImageName, failedParent)
+				mu.Unlock()
+			} else {
+				sem <- struct{}{}
+				var buf bytes.Buffer
+				w := io.MultiWriter(&buf)
+				imageTag, err := doBuild(ctx, w, n.artifact, tags[n.artifact.ImageName])
+				<-sem
+
+				mu.Lock()
+				fmt.Fprintf(out, "Building [%s]...\n", n.artifact.ImageName)
+				out.Write(buf.Bytes())
+				if err != nil {
+					errs[n.artifact.ImageName] = errors.Wrapf(err, "building [%s]", n.artifact.ImageName)
+				} else {
+					results[n.artifact.ImageName] = build.Artifact{ImageName: n.artifact.ImageName, Tag: imageTag}
+				}
+				mu.Unlock()
+			}
+
+			for _, child := range n.children {
+				if atomic.AddInt32(&child.pending, -1) == 0 {
+					schedule(child)
+				}
+			}
+		}()
+	}
+
+	for _, n := range nodes {
+		if n.pending == 0 {
+			schedule(n)
+		}
+	}
+	wg.Wait()
+
+	for _, a := range artifacts {
+		if err, found := errs[a.ImageName]; found {
+			return nil, err
+		}
+	}
+
+	ordered := make([]build.Artifact, len(artifacts))
+	for i, a := range artifacts {
+		ordered[i] = results[a.ImageName]
+	}
+	return ordered, nil
+}
+
+// buildDependencyGraph builds a DAG of artifacts, linking an artifact to the
+// other artifacts in this run that its Dockerfile uses as a FROM image.
+func buildDependencyGraph(ctx context.Context, artifacts []*latest.Artifact) ([]*artifactNode, error) {
+	byImageName := make(map[string]*artifactNode, len(artifacts))
+	nodes := make([]*artifactNode, len(artifacts))
+
+	for i, a := range artifacts {
+		nodes[i] = &artifactNode{artifact: a}
+		byImageName[a.ImageName] = nodes[i]
+	}
+
+	for _, n := range nodes {
+		if n.artifact.DockerArtifact == nil {
+			continue
+		}
+
+		baseImages, err := docker.GetBaseImages(ctx, n.artifact.Workspace, n.artifact.DockerArtifact)
+		if err != nil {
+			return nil, errors.Wrapf(err, "parsing Dockerfile for [%s]", n.artifact.ImageName)
+		}
+
+		for _, base := range baseImages {
+			parent, found := byImageName[base]
+			if !found || parent == n {
+				continue
+			}
+
+			parent.children = append(parent.children, n)
+			n.parents = append(n.parents, parent.artifact.ImageName)
+			n.pending++
+		}
+	}
+
+	if err := detectCycle(nodes); err != nil {
+		return nil, err
+	}
+
+	return nodes, nil
+}
+
+// detectCycle runs a Kahn's algorithm pass over the graph and fails if any
+// node is left with unresolved parents, which means it's part of a cycle.
+// Without this check, a cyclic dependency would leave every node in that
+// cycle permanently pending: buildArtifactsInParallel would schedule
+// nothing for them, wg.Wait would return immediately, and the caller would
+// see a nil error with zero-value build.Artifact entries instead of a
+// clear failure.
+func detectCycle(nodes []*artifactNode) error {
+	pending := make(map[*artifactNode]int32, len(nodes))
+	queue := make([]*artifactNode, 0, len(nodes))
+
+	for _, n := range nodes {
+		pending[n] = n.pending
+		if n.pending == 0 {
+			queue = append(queue, n)
+		}
+	}
+
+	visited := 0
+	for len(queue) > 0 {
+		n := queue[0]
+		queue = queue[1:]
+		visited++
+
+		for _, child := range n.children {
+			pending[child]--
+			if pending[child] == 0 {
+				queue = append(queue, child)
+			}
+		}
+	}
+
+	if visited == len(nodes) {
+		return nil
+	}
+
+	var stuck []string
+	for n, p := range pending {
+		if p > 0 {
+			stuck = append(stuck, n.artifact.ImageName)
+		}
+	}
+	sort.Strings(stuck)
+
+	return fmt.Errorf("cycle detected in artifact build dependencies involving: %s", strings.Join(stuck, ", "))
+}
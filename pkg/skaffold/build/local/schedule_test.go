@@ -0,0 +1,211 @@
+/*
+Copyright 2019 The Skaffold Authors
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package local
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"math/rand"
+	"path/filepath"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/GoogleContainerTools/skaffold/pkg/skaffold/build/tag"
+	"github.com/GoogleContainerTools/skaffold/pkg/skaffold/schema/latest"
+)
+
+// writeDockerfile writes a Dockerfile whose FROM lines reference froms, so
+// buildDependencyGraph discovers the same edges a real build would.
+func writeDockerfile(t *testing.T, dir string, froms ...string) string {
+	t.Helper()
+
+	var contents string
+	for _, from := range froms {
+		contents += "FROM " + from + "\n"
+	}
+	if contents == "" {
+		contents = "FROM scratch\n"
+	}
+
+	if err := ioutil.WriteFile(filepath.Join(dir, "Dockerfile"), []byte(contents), 0644); err != nil {
+		t.Fatalf("writing Dockerfile: %v", err)
+	}
+	return dir
+}
+
+func dockerArtifact(t *testing.T, imageName string, froms ...string) *latest.Artifact {
+	t.Helper()
+
+	return &latest.Artifact{
+		ImageName:    imageName,
+		Workspace:    writeDockerfile(t, t.TempDir(), froms...),
+		ArtifactType: latest.ArtifactType{DockerArtifact: &latest.DockerArtifact{}},
+	}
+}
+
+// recordingBuild returns an artifactBuildFunc that fails for any image name
+// in failFor, otherwise succeeds, recording every image it was actually
+// invoked for (goroutine-safe) and sleeping a random jittered amount so
+// finish order doesn't match artifact order.
+func recordingBuild(failFor map[string]bool) (artifactBuildFunc, *[]string, *sync.Mutex) {
+	var (
+		mu    sync.Mutex
+		calls []string
+	)
+
+	doBuild := func(ctx context.Context, out io.Writer, artifact *latest.Artifact, tag string) (string, error) {
+		time.Sleep(time.Duration(rand.Intn(5)) * time.Millisecond)
+
+		mu.Lock()
+		calls = append(calls, artifact.ImageName)
+		mu.Unlock()
+
+		if failFor[artifact.ImageName] {
+			return "", fmt.Errorf("injected failure for %s", artifact.ImageName)
+		}
+		return artifact.ImageName + ":built", nil
+	}
+
+	return doBuild, &calls, &mu
+}
+
+func TestBuildArtifactsInParallelOrderingIsDeterministic(t *testing.T) {
+	// base
+	//  |-- mid1
+	//  |-- mid2 --- top (depends on mid2)
+	base := dockerArtifact(t, "base")
+	mid1 := dockerArtifact(t, "mid1", "base")
+	mid2 := dockerArtifact(t, "mid2", "base")
+	top := dockerArtifact(t, "top", "mid2")
+	independent := dockerArtifact(t, "independent")
+
+	artifacts := []*latest.Artifact{top, independent, base, mid1, mid2}
+	tags := tag.ImageTags{}
+	for _, a := range artifacts {
+		tags[a.ImageName] = a.ImageName + ":tag"
+	}
+
+	buildFn, _, _ := recordingBuild(nil)
+	b := &Builder{concurrency: 0}
+
+	for i := 0; i < 10; i++ {
+		results, err := b.buildArtifactsInParallel(context.Background(), ioutil.Discard, tags, artifacts, buildFn)
+		if err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+		if len(results) != len(artifacts) {
+			t.Fatalf("got %d results, want %d", len(results), len(artifacts))
+		}
+		for idx, a := range artifacts {
+			if results[idx].ImageName != a.ImageName {
+				t.Fatalf("result %d: got %q, want %q (order must match input artifacts, not finish order)", idx, results[idx].ImageName, a.ImageName)
+			}
+		}
+	}
+}
+
+func TestBuildArtifactsInParallelFailurePropagatesToDependentsOnly(t *testing.T) {
+	// base
+	//  |-- child-fail --- grandchild (should never build: parent failed)
+	//  |-- child-ok (should still build: independent of the failure)
+	// independent (should still build: unrelated to the whole subgraph)
+	base := dockerArtifact(t, "base")
+	childFail := dockerArtifact(t, "child-fail", "base")
+	childOK := dockerArtifact(t, "child-ok", "base")
+	grandchild := dockerArtifact(t, "grandchild", "child-fail")
+	independent := dockerArtifact(t, "independent")
+
+	artifacts := []*latest.Artifact{base, childFail, childOK, grandchild, independent}
+	tags := tag.ImageTags{}
+	for _, a := range artifacts {
+		tags[a.ImageName] = a.ImageName + ":tag"
+	}
+
+	buildFn, calls, mu := recordingBuild(map[string]bool{"child-fail": true})
+	b := &Builder{concurrency: 0}
+
+	_, err := b.buildArtifactsInParallel(context.Background(), ioutil.Discard, tags, artifacts, buildFn)
+	if err == nil {
+		t.Fatal("expected an error because child-fail fails to build")
+	}
+
+	mu.Lock()
+	invoked := make(map[string]bool, len(*calls))
+	for _, name := range *calls {
+		invoked[name] = true
+	}
+	mu.Unlock()
+
+	for _, want := range []string{"base", "child-fail", "child-ok", "independent"} {
+		if !invoked[want] {
+			t.Errorf("expected %q to be built, but it never was", want)
+		}
+	}
+	if invoked["grandchild"] {
+		t.Error("expected grandchild to be skipped since its dependency child-fail failed, but it was built")
+	}
+}
+
+func TestDetectCycleNoCycle(t *testing.T) {
+	a := &artifactNode{artifact: &latest.Artifact{ImageName: "a"}}
+	b := &artifactNode{artifact: &latest.Artifact{ImageName: "b"}}
+	a.children = []*artifactNode{b}
+	b.pending = 1
+
+	if err := detectCycle([]*artifactNode{a, b}); err != nil {
+		t.Fatalf("expected no error, got: %v", err)
+	}
+}
+
+func TestDetectCycleDirect(t *testing.T) {
+	a := &artifactNode{artifact: &latest.Artifact{ImageName: "a"}}
+	b := &artifactNode{artifact: &latest.Artifact{ImageName: "b"}}
+	a.children = []*artifactNode{b}
+	b.children = []*artifactNode{a}
+	a.pending = 1
+	b.pending = 1
+
+	err := detectCycle([]*artifactNode{a, b})
+	if err == nil {
+		t.Fatal("expected a cycle error, got nil")
+	}
+}
+
+func TestDetectCycleThroughUnrelatedBranch(t *testing.T) {
+	// a -> b, and a separate cyclic pair c <-> d, should still be reported
+	// even though a/b are perfectly fine.
+	a := &artifactNode{artifact: &latest.Artifact{ImageName: "a"}}
+	b := &artifactNode{artifact: &latest.Artifact{ImageName: "b"}}
+	c := &artifactNode{artifact: &latest.Artifact{ImageName: "c"}}
+	d := &artifactNode{artifact: &latest.Artifact{ImageName: "d"}}
+
+	a.children = []*artifactNode{b}
+	b.pending = 1
+
+	c.children = []*artifactNode{d}
+	d.children = []*artifactNode{c}
+	c.pending = 1
+	d.pending = 1
+
+	err := detectCycle([]*artifactNode{a, b, c, d})
+	if err == nil {
+		t.Fatal("expected a cycle error, got nil")
+	}
+}
@@ -0,0 +1,116 @@
+/*
+Copyright 2019 The Skaffold Authors
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package local
+
+import (
+	"context"
+	"os"
+	"time"
+
+	"github.com/GoogleContainerTools/skaffold/pkg/skaffold/schema/latest"
+	"github.com/pkg/errors"
+)
+
+// Well-known values accepted for the `local.outputTimestamp` option, in
+// addition to an explicit RFC3339 timestamp.
+const (
+	// OutputTimestampZero stamps the image config and every layer's history
+	// with the Unix epoch, the same convention used by `docker build
+	// --timestamp`-less reproducible build tooling.
+	OutputTimestampZero = "zero"
+
+	// OutputTimestampSource derives the timestamp from the newest mtime
+	// amongst the artifact's build dependencies, or for a Bazel artifact
+	// from the mtime of its bazel-out stable-status.txt.
+	OutputTimestampSource = "source"
+
+	// OutputTimestampBuild leaves the daemon's wall-clock `created` time
+	// untouched. This is the default when no output timestamp is set.
+	OutputTimestampBuild = "build"
+)
+
+// rewriteImageTimestamp rewrites imageID's config `created` field and every
+// layer history entry to the timestamp selected by b.outputTimestamp, and
+// re-tags the result under imageID's existing tag so that the rest of the
+// build pipeline keeps referring to the same reference. It lets Skaffold
+// produce the same image bytes across runs, since the Docker daemon
+// otherwise stamps `created` with wall-clock time on every build.
+func (b *Builder) rewriteImageTimestamp(ctx context.Context, artifact *latest.Artifact, imageID string) (string, error) {
+	created, err := b.resolveOutputTimestamp(ctx, artifact)
+	if err != nil {
+		return "", err
+	}
+	if created.IsZero() {
+		return imageID, nil
+	}
+
+	rewritten, err := b.localDocker.RewriteCreatedTime(ctx, imageID, created)
+	if err != nil {
+		return "", errors.Wrapf(err, "rewriting timestamp on [%s]", imageID)
+	}
+
+	return rewritten, nil
+}
+
+func (b *Builder) resolveOutputTimestamp(ctx context.Context, artifact *latest.Artifact) (time.Time, error) {
+	switch b.outputTimestamp {
+	case "", OutputTimestampBuild:
+		return time.Time{}, nil
+
+	case OutputTimestampZero:
+		return time.Unix(0, 0).UTC(), nil
+
+	case OutputTimestampSource:
+		return b.newestDependencyTimestamp(ctx, artifact)
+
+	default:
+		t, err := time.Parse(time.RFC3339, b.outputTimestamp)
+		if err != nil {
+			return time.Time{}, errors.Wrapf(err, "%q is not one of %q, %q, %q or an RFC3339 timestamp", b.outputTimestamp, OutputTimestampZero, OutputTimestampSource, OutputTimestampBuild)
+		}
+		return t.UTC(), nil
+	}
+}
+
+// newestDependencyTimestamp returns the mtime of the most recently modified
+// file this artifact depends on, so that the image's `created` time reflects
+// the source that actually produced it rather than the moment `docker build`
+// happened to run. For a Bazel artifact it returns the mtime of the
+// bazel-out stable-status.txt file instead (see bazelStampTimestamp).
+func (b *Builder) newestDependencyTimestamp(ctx context.Context, artifact *latest.Artifact) (time.Time, error) {
+	if artifact.BazelArtifact != nil {
+		return bazelStampTimestamp(artifact.Workspace, artifact.BazelArtifact)
+	}
+
+	deps, err := b.DependenciesForArtifact(ctx, artifact)
+	if err != nil {
+		return time.Time{}, errors.Wrap(err, "getting dependencies")
+	}
+
+	var newest time.Time
+	for _, dep := range deps {
+		info, err := os.Stat(dep)
+		if err != nil {
+			continue
+		}
+		if info.ModTime().After(newest) {
+			newest = info.ModTime()
+		}
+	}
+
+	return newest.UTC(), nil
+}
@@ -0,0 +1,214 @@
+/*
+Copyright 2019 The Skaffold Authors
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package local
+
+import (
+	"context"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/GoogleContainerTools/skaffold/pkg/skaffold/schema/latest"
+)
+
+// fakeLocalDaemon is a minimal docker.LocalDaemon for tests that only need
+// to observe or control RewriteCreatedTime; every other method panics if
+// called, so a test fails loudly if it exercises a path it didn't expect to.
+type fakeLocalDaemon struct {
+	rewriteCreatedTimeCalled bool
+	gotCreated               time.Time
+	rewrittenImageID         string
+	rewriteErr               error
+}
+
+func (f *fakeLocalDaemon) Close() error                                          { panic("not implemented") }
+func (f *fakeLocalDaemon) Tag(ctx context.Context, imageID, tag string) error     { panic("not implemented") }
+func (f *fakeLocalDaemon) Ping(ctx context.Context) error                        { panic("not implemented") }
+func (f *fakeLocalDaemon) ImageExists(ctx context.Context, ref string) bool       { panic("not implemented") }
+func (f *fakeLocalDaemon) ImageRemoteDigest(ctx context.Context, ref string) string {
+	panic("not implemented")
+}
+func (f *fakeLocalDaemon) BaseImageDigest(ctx context.Context, workspace string, a *latest.DockerArtifact) (string, error) {
+	panic("not implemented")
+}
+
+func (f *fakeLocalDaemon) RewriteCreatedTime(ctx context.Context, imageID string, created time.Time) (string, error) {
+	f.rewriteCreatedTimeCalled = true
+	f.gotCreated = created
+	return f.rewrittenImageID, f.rewriteErr
+}
+
+func TestResolveOutputTimestamp(t *testing.T) {
+	tests := []struct {
+		description string
+		timestamp   string
+		wantZero    bool
+		wantErr     bool
+	}{
+		{description: "unset defaults to build timestamp", timestamp: "", wantZero: true},
+		{description: "explicit build timestamp", timestamp: OutputTimestampBuild, wantZero: true},
+		{description: "zero timestamp", timestamp: OutputTimestampZero, wantZero: false},
+		{description: "explicit RFC3339 timestamp", timestamp: "2019-10-02T15:00:00Z", wantZero: false},
+		{description: "garbage timestamp is an error", timestamp: "not-a-time", wantErr: true},
+	}
+
+	for _, test := range tests {
+		t.Run(test.description, func(t *testing.T) {
+			b := &Builder{outputTimestamp: test.timestamp}
+
+			got, err := b.resolveOutputTimestamp(context.Background(), &latest.Artifact{})
+			if test.wantErr {
+				if err == nil {
+					t.Fatal("expected an error, got nil")
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			if got.IsZero() != test.wantZero {
+				t.Fatalf("got zero time = %v, want %v", got.IsZero(), test.wantZero)
+			}
+		})
+	}
+}
+
+func TestResolveOutputTimestampExplicitValue(t *testing.T) {
+	b := &Builder{outputTimestamp: "2019-10-02T15:00:00Z"}
+
+	got, err := b.resolveOutputTimestamp(context.Background(), &latest.Artifact{})
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	want := time.Date(2019, 10, 2, 15, 0, 0, 0, time.UTC)
+	if !got.Equal(want) {
+		t.Fatalf("got %v, want %v", got, want)
+	}
+}
+
+func TestRewriteImageTimestampSkipsWhenBuildMode(t *testing.T) {
+	daemon := &fakeLocalDaemon{}
+	b := &Builder{outputTimestamp: "", localDocker: daemon}
+
+	got, err := b.rewriteImageTimestamp(context.Background(), &latest.Artifact{}, "sha256:original")
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if got != "sha256:original" {
+		t.Fatalf("got %q, want the imageID unchanged", got)
+	}
+	if daemon.rewriteCreatedTimeCalled {
+		t.Fatal("expected RewriteCreatedTime not to be called when no output timestamp is set")
+	}
+}
+
+func TestRewriteImageTimestampCallsLocalDaemon(t *testing.T) {
+	daemon := &fakeLocalDaemon{rewrittenImageID: "sha256:rewritten"}
+	b := &Builder{outputTimestamp: OutputTimestampZero, localDocker: daemon}
+
+	got, err := b.rewriteImageTimestamp(context.Background(), &latest.Artifact{}, "sha256:original")
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if !daemon.rewriteCreatedTimeCalled {
+		t.Fatal("expected RewriteCreatedTime to be called")
+	}
+	if !daemon.gotCreated.Equal(time.Unix(0, 0).UTC()) {
+		t.Fatalf("got created time %v, want the Unix epoch", daemon.gotCreated)
+	}
+	if got != "sha256:rewritten" {
+		t.Fatalf("got %q, want the daemon's rewritten imageID", got)
+	}
+}
+
+func TestNewestDependencyTimestampBazel(t *testing.T) {
+	dir := t.TempDir()
+	stampDir := filepath.Join(dir, "bazel-out")
+	if err := os.MkdirAll(stampDir, 0755); err != nil {
+		t.Fatalf("creating bazel-out dir: %v", err)
+	}
+	stampFile := filepath.Join(stampDir, "stable-status.txt")
+	if err := ioutil.WriteFile(stampFile, []byte("BUILD_TIMESTAMP 1\n"), 0644); err != nil {
+		t.Fatalf("writing stamp file: %v", err)
+	}
+
+	want := time.Date(2019, 1, 2, 3, 4, 5, 0, time.UTC)
+	if err := os.Chtimes(stampFile, want, want); err != nil {
+		t.Fatalf("setting stamp file mtime: %v", err)
+	}
+
+	b := &Builder{}
+	artifact := &latest.Artifact{
+		Workspace:    dir,
+		ArtifactType: latest.ArtifactType{BazelArtifact: &latest.BazelArtifact{}},
+	}
+
+	got, err := b.newestDependencyTimestamp(context.Background(), artifact)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if !got.Equal(want) {
+		t.Fatalf("got %v, want %v", got, want)
+	}
+}
+
+func TestNewestDependencyTimestampPicksNewestMtime(t *testing.T) {
+	dir := t.TempDir()
+
+	older := filepath.Join(dir, "older")
+	newer := filepath.Join(dir, "newer")
+	if err := ioutil.WriteFile(older, []byte("a"), 0644); err != nil {
+		t.Fatalf("writing %s: %v", older, err)
+	}
+	if err := ioutil.WriteFile(newer, []byte("b"), 0644); err != nil {
+		t.Fatalf("writing %s: %v", newer, err)
+	}
+
+	olderTime := time.Date(2019, 1, 1, 0, 0, 0, 0, time.UTC)
+	newerTime := time.Date(2020, 1, 1, 0, 0, 0, 0, time.UTC)
+	if err := os.Chtimes(older, olderTime, olderTime); err != nil {
+		t.Fatalf("setting mtime: %v", err)
+	}
+	if err := os.Chtimes(newer, newerTime, newerTime); err != nil {
+		t.Fatalf("setting mtime: %v", err)
+	}
+
+	script := filepath.Join(dir, "list-deps.sh")
+	contents := "#!/bin/sh\necho " + older + "\necho " + newer + "\n"
+	if err := ioutil.WriteFile(script, []byte(contents), 0755); err != nil {
+		t.Fatalf("writing list-deps.sh: %v", err)
+	}
+
+	b := &Builder{}
+	artifact := &latest.Artifact{
+		Workspace: dir,
+		ArtifactType: latest.ArtifactType{
+			CustomArtifact: &latest.CustomArtifact{DependenciesCommand: script},
+		},
+	}
+
+	got, err := b.newestDependencyTimestamp(context.Background(), artifact)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if !got.Equal(newerTime) {
+		t.Fatalf("got %v, want the newer file's mtime %v", got, newerTime)
+	}
+}
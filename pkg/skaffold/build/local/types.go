@@ -0,0 +1,77 @@
+/*
+Copyright 2019 The Skaffold Authors
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package local
+
+import (
+	"sync"
+
+	"github.com/GoogleContainerTools/skaffold/pkg/skaffold/docker"
+	"github.com/pkg/errors"
+)
+
+// Builder builds artifacts on the machine Skaffold runs on, using the local
+// Docker daemon when it's available.
+type Builder struct {
+	localDocker  docker.LocalDaemon
+	localCluster bool
+	kubeContext  string
+	pushImages   bool
+
+	// namespace is the Kubernetes namespace used for any in-cluster
+	// fallback build pods.
+	namespace string
+
+	// concurrency is the maximum number of artifacts built at once.
+	// 0 means unbounded.
+	concurrency int
+
+	// outputTimestamp is one of OutputTimestampZero, OutputTimestampSource,
+	// OutputTimestampBuild, an RFC3339 timestamp, or "" (same as
+	// OutputTimestampBuild).
+	outputTimestamp string
+
+	// dockerPingOnce/dockerUnreachable cache whether the local Docker
+	// daemon could be reached, for the lifetime of this Builder.
+	dockerPingOnce    sync.Once
+	dockerUnreachable bool
+
+	// cache is the content-addressable build cache. Nil disables caching.
+	cache *buildCache
+}
+
+// NewBuilder creates a new Builder that builds artifacts on the local machine.
+func NewBuilder(localDocker docker.LocalDaemon, localCluster bool, kubeContext, namespace string, pushImages bool, concurrency int, outputTimestamp string, useCache bool) (*Builder, error) {
+	b := &Builder{
+		localDocker:     localDocker,
+		localCluster:    localCluster,
+		kubeContext:     kubeContext,
+		namespace:       namespace,
+		pushImages:      pushImages,
+		concurrency:     concurrency,
+		outputTimestamp: outputTimestamp,
+	}
+
+	if useCache {
+		cache, err := newBuildCache()
+		if err != nil {
+			return nil, errors.Wrap(err, "creating build cache")
+		}
+		b.cache = cache
+	}
+
+	return b, nil
+}
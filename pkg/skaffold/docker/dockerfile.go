@@ -0,0 +1,64 @@
+/*
+Copyright 2019 The Skaffold Authors
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package docker
+
+import (
+	"bufio"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+const defaultDockerfilePath = "Dockerfile"
+
+// readDockerfileDependencies returns the path of the Dockerfile itself. The
+// Dockerfile is not parsed here, so the sources of its COPY and ADD
+// instructions are not included.
+func readDockerfileDependencies(workspace, dockerfilePath string) ([]string, error) {
+	path := dockerfilePath
+	if path == "" {
+		path = defaultDockerfilePath
+	}
+
+	return []string{filepath.Join(workspace, path)}, nil
+}
+
+// parseDockerfileFromImages returns the image reference on every FROM line
+// of the Dockerfile, in order, including repeated stages.
+func parseDockerfileFromImages(workspace, dockerfilePath string) ([]string, error) {
+	path := dockerfilePath
+	if path == "" {
+		path = defaultDockerfilePath
+	}
+
+	f, err := os.Open(filepath.Join(workspace, path))
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	var images []string
+	scanner := bufio.NewScanner(f)
+	for scanner.Scan() {
+		fields := strings.Fields(scanner.Text())
+		if len(fields) >= 2 && strings.EqualFold(fields[0], "FROM") {
+			images = append(images, fields[1])
+		}
+	}
+
+	return images, scanner.Err()
+}
@@ -0,0 +1,66 @@
+/*
+Copyright 2019 The Skaffold Authors
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package docker
+
+import (
+	"context"
+	"time"
+
+	"github.com/GoogleContainerTools/skaffold/pkg/skaffold/schema/latest"
+)
+
+// LocalDaemon talks to the Docker daemon running on the same machine as
+// Skaffold.
+type LocalDaemon interface {
+	Close() error
+	Tag(ctx context.Context, imageID, tag string) error
+
+	// Ping returns an error if the daemon can't be reached.
+	Ping(ctx context.Context) error
+
+	// RewriteCreatedTime rewrites imageID's config `created` field and every
+	// layer's history timestamp to created, re-tagging the result under
+	// imageID's existing reference, and returns the new imageID.
+	RewriteCreatedTime(ctx context.Context, imageID string, created time.Time) (string, error)
+
+	// ImageExists returns true if digestOrImageID refers to an image present
+	// in the local daemon's image store.
+	ImageExists(ctx context.Context, digestOrImageID string) bool
+
+	// ImageRemoteDigest resolves digestOrImageID's tag in its remote
+	// registry and returns the digest it currently points to, or "" if it
+	// can't be resolved.
+	ImageRemoteDigest(ctx context.Context, digestOrImageID string) string
+
+	// BaseImageDigest returns the digest of the base image a Dockerfile
+	// build currently resolves to, so the build cache can be invalidated
+	// when the base image is updated.
+	BaseImageDigest(ctx context.Context, workspace string, a *latest.DockerArtifact) (string, error)
+}
+
+// GetDependencies returns the Dockerfile of a Dockerfile build. The files
+// that its COPY and ADD instructions read are not listed.
+func GetDependencies(ctx context.Context, workspace string, a *latest.DockerArtifact) ([]string, error) {
+	return readDockerfileDependencies(workspace, a.DockerfilePath)
+}
+
+// GetBaseImages parses a Dockerfile for FROM instructions and returns the
+// base images it references, so the local builder can tell which of those
+// are other artifacts being built in the same run.
+func GetBaseImages(ctx context.Context, workspace string, a *latest.DockerArtifact) ([]string, error) {
+	return parseDockerfileFromImages(workspace, a.DockerfilePath)
+}
@@ -0,0 +1,89 @@
+/*
+Copyright 2019 The Skaffold Authors
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package latest
+
+// Artifact describes how to build one application image.
+type Artifact struct {
+	// ImageName is the name of the image, as referenced in the Kubernetes
+	// manifests.
+	ImageName string `yaml:"image"`
+
+	// Workspace is the directory containing the artifact's sources,
+	// relative to the skaffold.yaml.
+	Workspace string `yaml:"context,omitempty"`
+
+	// PreferInCluster forces the local builder to build this artifact with
+	// an in-cluster Kaniko pod, even when a local Docker daemon is
+	// available.
+	PreferInCluster bool `yaml:"preferInCluster,omitempty"`
+
+	// InClusterBuilderImage overrides the Kaniko executor image used for
+	// the in-cluster fallback build, for users who need their own fork or
+	// pinned version.
+	InClusterBuilderImage string `yaml:"inClusterBuilderImage,omitempty"`
+
+	ArtifactType `yaml:",inline"`
+}
+
+// ArtifactType describes which builder is configured for an artifact.
+// Exactly one field should be non-nil.
+type ArtifactType struct {
+	DockerArtifact    *DockerArtifact    `yaml:"docker,omitempty"`
+	BazelArtifact     *BazelArtifact     `yaml:"bazel,omitempty"`
+	JibMavenArtifact  *JibMavenArtifact  `yaml:"jibMaven,omitempty"`
+	JibGradleArtifact *JibGradleArtifact `yaml:"jibGradle,omitempty"`
+	CustomArtifact    *CustomArtifact    `yaml:"custom,omitempty"`
+}
+
+// DockerArtifact describes an artifact built from a Dockerfile.
+type DockerArtifact struct {
+	DockerfilePath string             `yaml:"dockerfile,omitempty"`
+	BuildArgs      map[string]*string `yaml:"buildArgs,omitempty"`
+}
+
+// BazelArtifact describes an artifact built with Bazel.
+type BazelArtifact struct {
+	BuildTarget string   `yaml:"target,omitempty"`
+	BuildArgs   []string `yaml:"args,omitempty"`
+}
+
+// JibMavenArtifact describes an artifact built with Jib via Maven.
+type JibMavenArtifact struct {
+	Module  string `yaml:"module,omitempty"`
+	Profile string `yaml:"profile,omitempty"`
+}
+
+// JibGradleArtifact describes an artifact built with Jib via Gradle.
+type JibGradleArtifact struct {
+	Project string `yaml:"project,omitempty"`
+}
+
+// CustomArtifact describes an artifact built by shelling out to an external
+// command, for build tools Skaffold doesn't support natively.
+type CustomArtifact struct {
+	// BuildCommand is run to build and push (or load) the image. Skaffold
+	// substitutes $IMAGE with the fully qualified tag to build. The command
+	// must print a single JSON line to stdout containing either an
+	// "imageID" (for an image loaded into the local daemon) or a "digest"
+	// (for one pushed directly to a registry).
+	BuildCommand string `yaml:"buildCommand,omitempty"`
+
+	// DependenciesCommand is run to list the files this artifact depends
+	// on, one path per line of stdout. If empty, the artifact is never
+	// considered stale by file watching.
+	DependenciesCommand string `yaml:"dependenciesCommand,omitempty"`
+}